@@ -0,0 +1,285 @@
+package kharki
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/docker/go-connections/nat"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const kafkaStartScriptPath = "/testcontainers_start.sh"
+
+type kafkaOptions struct {
+	count          int
+	hostnamePrefix string
+	brokerPort     int
+	hostPort       int
+	zk             *ZooKeeperCluster
+	listeners      []string
+	networkNames   []string
+	retryCount     int
+	retryInterval  time.Duration
+}
+
+type KafkaClusterOption = func(*kafkaOptions)
+
+func WithKafkaCount(count int) KafkaClusterOption {
+	return func(ko *kafkaOptions) {
+		ko.count = count
+	}
+}
+
+func WithKafkaZooKeeper(zkc *ZooKeeperCluster) KafkaClusterOption {
+	return func(ko *kafkaOptions) {
+		ko.zk = zkc
+	}
+}
+
+// WithKafkaListeners sets the names of the internal, inter-broker listeners
+// advertised on the docker network (in addition to the host-facing
+// PLAINTEXT_HOST listener that every cluster gets automatically). The first
+// name becomes KAFKA_INTER_BROKER_LISTENER_NAME and is the only one of them
+// put into KAFKA_ADVERTISED_LISTENERS. All of them are wired into
+// KAFKA_LISTENERS and KAFKA_LISTENER_SECURITY_PROTOCOL_MAP as PLAINTEXT
+// listeners.
+func WithKafkaListeners(listeners ...string) KafkaClusterOption {
+	return func(ko *kafkaOptions) {
+		ko.listeners = listeners
+	}
+}
+
+type KafkaCluster struct {
+	options     *kafkaOptions
+	requests    []testcontainers.GenericContainerRequest
+	containers  []testcontainers.Container
+	brokerPorts []string
+}
+
+func (c KafkaCluster) probe() error {
+	cfg := sarama.NewConfig()
+	cfg.Version = sarama.V2_8_0_0
+
+	admin, err := sarama.NewClusterAdmin(c.BootstrapServers(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to probe Kafka cluster: %w", err)
+	}
+	defer admin.Close()
+
+	_, controllerID, err := admin.DescribeCluster()
+	if err != nil {
+		return fmt.Errorf("failed to probe Kafka cluster: %w", err)
+	}
+
+	if controllerID < 0 {
+		return fmt.Errorf("failed to probe Kafka cluster: no controller elected")
+	}
+
+	return nil
+}
+
+// BootstrapServers returns the localhost:port addresses of the cluster's
+// mapped host-listener ports.
+func (c KafkaCluster) BootstrapServers() []string {
+	ss := make([]string, len(c.brokerPorts))
+	for i, p := range c.brokerPorts {
+		ss[i] = fmt.Sprintf("localhost:%s", p)
+	}
+
+	return ss
+}
+
+func (c KafkaCluster) Controller() (string, error) {
+	cfg := sarama.NewConfig()
+	cfg.Version = sarama.V2_8_0_0
+
+	admin, err := sarama.NewClusterAdmin(c.BootstrapServers(), cfg)
+	if err != nil {
+		return "", fmt.Errorf("failed to identify Kafka controller: %w", err)
+	}
+	defer admin.Close()
+
+	_, controllerID, err := admin.DescribeCluster()
+	if err != nil {
+		return "", fmt.Errorf("failed to identify Kafka controller: %w", err)
+	}
+
+	return strconv.Itoa(int(controllerID)), nil
+}
+
+// kafkaStartScript rewrites KAFKA_ADVERTISED_LISTENERS with the host's
+// mapped port for the PLAINTEXT_HOST listener, which isn't known until after
+// the container is up, then hands off to the image's normal entrypoint.
+func kafkaStartScript(hostname string, brokerPort int, hostMappedPort string, interBrokerListener string, securityProtocolMap string) string {
+	return fmt.Sprintf(`#!/bin/sh
+export KAFKA_ADVERTISED_LISTENERS="%s://%s:%d,PLAINTEXT_HOST://localhost:%s"
+export KAFKA_LISTENER_SECURITY_PROTOCOL_MAP="%s"
+export KAFKA_INTER_BROKER_LISTENER_NAME="%s"
+exec /etc/confluent/docker/run
+`, interBrokerListener, hostname, brokerPort, hostMappedPort, securityProtocolMap, interBrokerListener)
+}
+
+func (c *KafkaCluster) Start(ctx context.Context) error {
+	req := make(testcontainers.ParallelContainerRequest, len(c.requests))
+	for i, r := range c.requests {
+		req[i] = r
+	}
+
+	for _, n := range c.options.networkNames {
+		r := testcontainers.GenericNetworkRequest{
+			NetworkRequest: testcontainers.NetworkRequest{Name: n},
+		}
+		if _, err := testcontainers.GenericNetwork(ctx, r); err != nil {
+			return fmt.Errorf("failed to create network %q: %w", n, err)
+		}
+	}
+
+	var err error
+	c.containers, err = testcontainers.ParallelContainers(ctx, req, testcontainers.ParallelContainersOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to start Kafka container: %w", err)
+	}
+
+	c.brokerPorts = make([]string, len(c.containers))
+	for i, container := range c.containers {
+		hp, err := container.MappedPort(ctx, nat.Port(strconv.Itoa(c.options.hostPort)))
+		if err != nil {
+			return fmt.Errorf("failed to get port for Kafka container: %w", err)
+		}
+
+		c.brokerPorts[i] = hp.Port()
+	}
+
+	success := false
+	for i := c.options.retryCount; i > 0; i-- {
+		if err := c.probe(); err != nil {
+			time.Sleep(c.options.retryInterval)
+			continue
+		}
+
+		success = true
+		break
+	}
+
+	if !success {
+		return fmt.Errorf("failed to start Kafka cluster within timeout")
+	}
+
+	return nil
+}
+
+// kafkaConfigureHook returns a PostStarts lifecycle hook that writes the
+// broker's start script as soon as the container exists (and its mapped
+// port is known), but before the host-port wait strategy starts polling —
+// the broker's entrypoint blocks until this file appears, so the copy must
+// happen here rather than after ParallelContainers returns.
+func kafkaConfigureHook(hostname string, brokerPort int, hostPort int, interBrokerListener string, securityProtocolMap string) testcontainers.ContainerLifecycleHooks {
+	return testcontainers.ContainerLifecycleHooks{
+		PostStarts: []testcontainers.ContainerHook{
+			func(ctx context.Context, container testcontainers.Container) error {
+				hp, err := container.MappedPort(ctx, nat.Port(strconv.Itoa(hostPort)))
+				if err != nil {
+					return fmt.Errorf("failed to get port for Kafka container %q: %w", hostname, err)
+				}
+
+				script := kafkaStartScript(hostname, brokerPort, hp.Port(), interBrokerListener, securityProtocolMap)
+				if err := container.CopyToContainer(ctx, []byte(script), kafkaStartScriptPath, 0o755); err != nil {
+					return fmt.Errorf("failed to configure Kafka container %q: %w", hostname, err)
+				}
+
+				return nil
+			},
+		},
+	}
+}
+
+func kafkaSecurityProtocolMap(listeners []string) string {
+	pp := make([]string, 0, len(listeners)+1)
+	for _, l := range listeners {
+		pp = append(pp, l+":PLAINTEXT")
+	}
+	pp = append(pp, "PLAINTEXT_HOST:PLAINTEXT")
+
+	return strings.Join(pp, ",")
+}
+
+func NewKafkaCluster(opts ...KafkaClusterOption) *KafkaCluster {
+	o := &kafkaOptions{
+		count:          1,
+		hostnamePrefix: "kafka",
+		brokerPort:     9092,
+		hostPort:       9093,
+		listeners:      []string{"BROKER"},
+		networkNames:   []string{"testcontainers"},
+		retryCount:     30,
+		retryInterval:  time.Second * 2,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	c := &KafkaCluster{
+		options:  o,
+		requests: make([]testcontainers.GenericContainerRequest, o.count),
+	}
+
+	var zkConnect string
+	if o.zk != nil {
+		zko := o.zk.options
+		hnpf := strings.ToLower(zko.hostnamePrefix) + "-"
+		ss := make([]string, zko.count)
+		for i := 0; i < zko.count; i++ {
+			ss[i] = fmt.Sprintf("%s%d:%d", hnpf, i+1, zko.clientPort)
+		}
+		zkConnect = strings.Join(ss, ",")
+	}
+
+	brokerListeners := make([]string, 0, len(o.listeners))
+	for _, l := range o.listeners {
+		brokerListeners = append(brokerListeners, fmt.Sprintf("%s://0.0.0.0:%d", l, o.brokerPort))
+	}
+	listenersEnv := strings.Join(append(brokerListeners, fmt.Sprintf("PLAINTEXT_HOST://0.0.0.0:%d", o.hostPort)), ",")
+	securityProtocolMap := kafkaSecurityProtocolMap(o.listeners)
+
+	bp := strconv.Itoa(o.brokerPort) + "/tcp"
+	hp := strconv.Itoa(o.hostPort) + "/tcp"
+	hnpf := strings.ToLower(o.hostnamePrefix) + "-"
+
+	for i := range c.requests {
+		id := i + 1
+		hn := hnpf + strconv.Itoa(id)
+
+		c.requests[i] = testcontainers.GenericContainerRequest{
+			ContainerRequest: testcontainers.ContainerRequest{
+				Image:    "confluentinc/cp-kafka:7.3.2",
+				Hostname: hn,
+				Env: map[string]string{
+					"KAFKA_BROKER_ID":                        strconv.Itoa(id),
+					"KAFKA_ZOOKEEPER_CONNECT":                zkConnect,
+					"KAFKA_LISTENERS":                        listenersEnv,
+					"KAFKA_ADVERTISED_LISTENERS":             fmt.Sprintf("%s://%s:%d,PLAINTEXT_HOST://localhost:%d", o.listeners[0], hn, o.brokerPort, o.hostPort),
+					"KAFKA_LISTENER_SECURITY_PROTOCOL_MAP":   securityProtocolMap,
+					"KAFKA_INTER_BROKER_LISTENER_NAME":       o.listeners[0],
+					"KAFKA_OFFSETS_TOPIC_REPLICATION_FACTOR": strconv.Itoa(o.count),
+				},
+				ExposedPorts: []string{bp, hp},
+				Networks:     o.networkNames,
+				Entrypoint:   []string{"sh", "-c"},
+				Cmd:          []string{fmt.Sprintf("while [ ! -f %s ]; do sleep 0.1; done; %s", kafkaStartScriptPath, kafkaStartScriptPath)},
+				WaitingFor:   wait.NewHostPortStrategy(nat.Port(hp)),
+				LifecycleHooks: []testcontainers.ContainerLifecycleHooks{
+					kafkaConfigureHook(hn, o.brokerPort, o.hostPort, o.listeners[0], securityProtocolMap),
+				},
+			},
+			Started: true,
+		}
+	}
+
+	return c
+}
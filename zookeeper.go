@@ -3,16 +3,20 @@ package kharki
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/docker/docker/api/types/container"
 	"github.com/docker/go-connections/nat"
 	"github.com/go-zookeeper/zk"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
 )
 
+const defaultZooKeeperVersion = "7.3.2"
+
 type zkOptions struct {
 	count            int
 	hostnamePrefix   string
@@ -22,6 +26,27 @@ type zkOptions struct {
 	networkNames     []string
 	retryCount       int
 	retryInterval    time.Duration
+
+	image                    string
+	version                  string
+	jvmFlags                 []string
+	tickTime                 int
+	initLimit                int
+	syncLimit                int
+	autoPurgeSnapRetainCount int
+	autoPurgePurgeInterval   int
+	fourLWWhitelist          []string
+	extraEnv                 map[string]string
+
+	secureClientPort int
+	tlsCA            []byte
+	tlsCert          []byte
+	tlsKey           []byte
+	saslUser         string
+	saslPass         string
+
+	dataDir string
+	tmpfs   bool
 }
 
 type ZooKeeperClusterOption = func(*zkOptions)
@@ -32,14 +57,251 @@ func WithZooKeeperCount(count int) ZooKeeperClusterOption {
 	}
 }
 
+// WithZooKeeperImage overrides the container image repository, leaving the
+// version tag set by WithZooKeeperVersion (or its default) untouched.
+func WithZooKeeperImage(image string) ZooKeeperClusterOption {
+	return func(zko *zkOptions) {
+		zko.image = image
+	}
+}
+
+// WithZooKeeperVersion overrides the image tag, e.g. to test against a
+// pre-3.5 ensemble where four-letter words are enabled by default instead
+// of gated behind 4lw.commands.whitelist.
+func WithZooKeeperVersion(tag string) ZooKeeperClusterOption {
+	return func(zko *zkOptions) {
+		zko.version = tag
+	}
+}
+
+func WithZooKeeperJVMFlags(flags ...string) ZooKeeperClusterOption {
+	return func(zko *zkOptions) {
+		zko.jvmFlags = flags
+	}
+}
+
+func WithZooKeeperTickTime(ms int) ZooKeeperClusterOption {
+	return func(zko *zkOptions) {
+		zko.tickTime = ms
+	}
+}
+
+func WithZooKeeperInitLimit(ticks int) ZooKeeperClusterOption {
+	return func(zko *zkOptions) {
+		zko.initLimit = ticks
+	}
+}
+
+func WithZooKeeperSyncLimit(ticks int) ZooKeeperClusterOption {
+	return func(zko *zkOptions) {
+		zko.syncLimit = ticks
+	}
+}
+
+func WithZooKeeperAutoPurge(snapRetainCount, purgeInterval int) ZooKeeperClusterOption {
+	return func(zko *zkOptions) {
+		zko.autoPurgeSnapRetainCount = snapRetainCount
+		zko.autoPurgePurgeInterval = purgeInterval
+	}
+}
+
+// WithZooKeeperFourLetterWordsWhitelist sets the four-letter-word commands
+// (e.g. "srvr", "mntr", or "*" for all) allowed on ZooKeeper 3.5+, where they
+// are gated behind 4lw.commands.whitelist. probe() relies on "srvr" being
+// allowed. If a non-default version is selected and this option is not
+// given, the whitelist is set to "*". With TLS enabled and an empty
+// whitelist, probe() only checks that a session can be established, so
+// Leader() returns "" and Followers() returns no servers.
+func WithZooKeeperFourLetterWordsWhitelist(words ...string) ZooKeeperClusterOption {
+	return func(zko *zkOptions) {
+		zko.fourLWWhitelist = words
+	}
+}
+
+func WithZooKeeperExtraEnv(env map[string]string) ZooKeeperClusterOption {
+	return func(zko *zkOptions) {
+		zko.extraEnv = env
+	}
+}
+
+// WithZooKeeperTLS mounts the given PEM-encoded CA, certificate and key into
+// every ensemble member and exposes a secure client port alongside the
+// plaintext one, switching the connection factory to Netty so TLS can be
+// terminated. probe() then speaks the four-letter-word protocol directly over
+// TLS, since go-zookeeper's FLWSrvr does not support it, or, when the
+// four-letter-word whitelist is empty, only checks that a session over TLS
+// can be established.
+func WithZooKeeperTLS(caPEM, certPEM, keyPEM []byte) ZooKeeperClusterOption {
+	return func(zko *zkOptions) {
+		zko.tlsCA = caPEM
+		zko.tlsCert = certPEM
+		zko.tlsKey = keyPEM
+	}
+}
+
+// WithZooKeeperSASL enables SASL DIGEST-MD5 auth for the ensemble by
+// mounting a generated JAAS login config that defines the given user and
+// password. No superuser is configured.
+func WithZooKeeperSASL(user, pass string) ZooKeeperClusterOption {
+	return func(zko *zkOptions) {
+		zko.saslUser = user
+		zko.saslPass = pass
+	}
+}
+
+// WithZooKeeperDataDir binds each ensemble member's data and log directories
+// under a per-hostname subdirectory of hostPath, so Start can be followed by
+// Reattach against the same on-disk state after a restart.
+func WithZooKeeperDataDir(hostPath string) ZooKeeperClusterOption {
+	return func(zko *zkOptions) {
+		zko.dataDir = hostPath
+	}
+}
+
+// WithZooKeeperTmpfs mounts the data and log directories on tmpfs instead of
+// the container's writable layer, trading persistence for faster I/O.
+func WithZooKeeperTmpfs(enabled bool) ZooKeeperClusterOption {
+	return func(zko *zkOptions) {
+		zko.tmpfs = enabled
+	}
+}
+
 type ZooKeeperCluster struct {
-	options     *zkOptions
-	requests    []testcontainers.GenericContainerRequest
-	containers  []testcontainers.Container
-	clientPorts []string
+	options           *zkOptions
+	requests          []testcontainers.GenericContainerRequest
+	containers        []testcontainers.Container
+	clientPorts       []string
+	secureClientPorts []string
+	hostnames         []string
+}
+
+type zkAuth struct {
+	scheme string
+	auth   []byte
+}
+
+type connOptions struct {
+	sessionTimeout time.Duration
+	auth           []zkAuth
+	logger         zk.Logger
+	maxRetries     int
+	retryInterval  time.Duration
+}
+
+type ConnOption = func(*connOptions)
+
+func WithSessionTimeout(d time.Duration) ConnOption {
+	return func(co *connOptions) {
+		co.sessionTimeout = d
+	}
+}
+
+func WithAuth(scheme string, auth []byte) ConnOption {
+	return func(co *connOptions) {
+		co.auth = append(co.auth, zkAuth{scheme: scheme, auth: auth})
+	}
+}
+
+func WithLogger(l zk.Logger) ConnOption {
+	return func(co *connOptions) {
+		co.logger = l
+	}
+}
+
+// WithReconnectPolicy retries session establishment up to maxRetries times,
+// sleeping interval between attempts, if the ZooKeeper ensemble is not yet
+// reachable (e.g. a fresh container still warming up). It does not affect
+// zk.Conn's own reconnection behaviour once a session has been established.
+func WithReconnectPolicy(maxRetries int, interval time.Duration) ConnOption {
+	return func(co *connOptions) {
+		co.maxRetries = maxRetries
+		co.retryInterval = interval
+	}
+}
+
+// Servers returns the localhost:port addresses of the cluster's mapped client ports.
+func (c ZooKeeperCluster) Servers() []string {
+	ss := make([]string, len(c.clientPorts))
+	for i, p := range c.clientPorts {
+		ss[i] = fmt.Sprintf("localhost:%s", p)
+	}
+
+	return ss
+}
+
+// Connect dials the cluster's mapped client ports and returns a live ZooKeeper
+// session, blocking until the session is established or ctx is done. If
+// WithReconnectPolicy was given, a failed attempt is retried rather than
+// returned to the caller.
+func (c ZooKeeperCluster) Connect(ctx context.Context, opts ...ConnOption) (*zk.Conn, <-chan zk.Event, error) {
+	o := &connOptions{
+		sessionTimeout: time.Second * 10,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		var conn *zk.Conn
+		var events <-chan zk.Event
+		conn, events, err = c.connectOnce(ctx, o)
+		if err == nil {
+			return conn, events, nil
+		}
+
+		if attempt >= o.maxRetries || ctx.Err() != nil {
+			return nil, nil, err
+		}
+
+		time.Sleep(o.retryInterval)
+	}
+}
+
+func (c ZooKeeperCluster) connectOnce(ctx context.Context, o *connOptions) (*zk.Conn, <-chan zk.Event, error) {
+	var zkOpts []zk.Option
+	if o.logger != nil {
+		zkOpts = append(zkOpts, zk.WithLogger(o.logger))
+	}
+
+	conn, events, err := zk.Connect(c.Servers(), o.sessionTimeout, zkOpts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to ZooKeeper: %w", err)
+	}
+
+	for _, a := range o.auth {
+		if err := conn.AddAuth(a.scheme, a.auth); err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("failed to add auth to ZooKeeper connection: %w", err)
+		}
+	}
+
+waitForSession:
+	for {
+		select {
+		case e := <-events:
+			if e.State == zk.StateHasSession {
+				break waitForSession
+			}
+		case <-ctx.Done():
+			conn.Close()
+			return nil, nil, fmt.Errorf("failed to connect to ZooKeeper: %w", ctx.Err())
+		}
+	}
+
+	return conn, events, nil
 }
 
 func (c ZooKeeperCluster) probe() ([]*zk.ServerStats, error) {
+	if c.options.tlsCA != nil {
+		if len(c.options.fourLWWhitelist) == 0 {
+			return c.probeTLSConn()
+		}
+
+		return c.probeTLSFLW()
+	}
+
 	ss := make([]string, len(c.clientPorts))
 	for i, p := range c.clientPorts {
 		ss[i] = fmt.Sprintf("localhost:%s", p)
@@ -125,6 +387,19 @@ func (c *ZooKeeperCluster) Start(ctx context.Context) error {
 		c.clientPorts[i] = hp.Port()
 	}
 
+	if c.options.tlsCA != nil {
+		c.secureClientPorts = make([]string, len(c.containers))
+		for i, container := range c.containers {
+			scp := strconv.Itoa(c.options.secureClientPort)
+			hp, err := container.MappedPort(ctx, nat.Port(scp))
+			if err != nil {
+				return fmt.Errorf("failed to get secure port for ZooKeeper container: %w", err)
+			}
+
+			c.secureClientPorts[i] = hp.Port()
+		}
+	}
+
 	if len(req) > 1 {
 		success := false
 		for i := c.options.retryCount; i > 0; i-- {
@@ -145,6 +420,22 @@ func (c *ZooKeeperCluster) Start(ctx context.Context) error {
 	return nil
 }
 
+// Reattach behaves like Start, but reuses a running container named after
+// each member's hostname (such as one left by an earlier Reattach) instead of
+// creating a fresh one, skipping the ensemble bootstrap cost when combined
+// with WithZooKeeperDataDir. Containers created by Start are not given those
+// names and are not reused.
+func (c *ZooKeeperCluster) Reattach(ctx context.Context) error {
+	for i := range c.requests {
+		c.requests[i].Reuse = true
+		if c.requests[i].ContainerRequest.Name == "" {
+			c.requests[i].ContainerRequest.Name = c.hostnames[i]
+		}
+	}
+
+	return c.Start(ctx)
+}
+
 func NewZooKeeperCluster(opts ...ZooKeeperClusterOption) *ZooKeeperCluster {
 	o := &zkOptions{
 		count:            1,
@@ -155,12 +446,19 @@ func NewZooKeeperCluster(opts ...ZooKeeperClusterOption) *ZooKeeperCluster {
 		networkNames:     []string{"testcontainers"},
 		retryCount:       30,
 		retryInterval:    time.Second * 2,
+		image:            "confluentinc/cp-zookeeper",
+		version:          "7.3.2",
+		secureClientPort: 2281,
 	}
 
 	for _, opt := range opts {
 		opt(o)
 	}
 
+	if o.version != defaultZooKeeperVersion && o.fourLWWhitelist == nil {
+		o.fourLWWhitelist = []string{"*"}
+	}
+
 	c := &ZooKeeperCluster{
 		options:  o,
 		requests: make([]testcontainers.GenericContainerRequest, o.count),
@@ -170,6 +468,9 @@ func NewZooKeeperCluster(opts ...ZooKeeperClusterOption) *ZooKeeperCluster {
 	for i, p := range []int{o.clientPort, o.leaderPeerPort, o.electionPeerPort} {
 		pp[i] = strconv.Itoa(p) + "/tcp"
 	}
+	if o.tlsCA != nil {
+		pp = append(pp, strconv.Itoa(o.secureClientPort)+"/tcp")
+	}
 
 	hnpf := strings.ToLower(o.hostnamePrefix) + "-"
 	hnsf := ":" + strconv.Itoa(o.leaderPeerPort) + ":" + strconv.Itoa(o.electionPeerPort)
@@ -184,23 +485,93 @@ func NewZooKeeperCluster(opts ...ZooKeeperClusterOption) *ZooKeeperCluster {
 
 	zks := strings.Join(ss, ";")
 
+	env := map[string]string{
+		"ZOOKEEPER_SERVERS": zks,
+	}
+	if o.tickTime > 0 {
+		env["ZOOKEEPER_TICK_TIME"] = strconv.Itoa(o.tickTime)
+	}
+	if o.initLimit > 0 {
+		env["ZOOKEEPER_INIT_LIMIT"] = strconv.Itoa(o.initLimit)
+	}
+	if o.syncLimit > 0 {
+		env["ZOOKEEPER_SYNC_LIMIT"] = strconv.Itoa(o.syncLimit)
+	}
+	if o.autoPurgeSnapRetainCount > 0 {
+		env["ZOOKEEPER_SNAP_RETAIN_COUNT"] = strconv.Itoa(o.autoPurgeSnapRetainCount)
+	}
+	if o.autoPurgePurgeInterval > 0 {
+		env["ZOOKEEPER_PURGE_INTERVAL"] = strconv.Itoa(o.autoPurgePurgeInterval)
+	}
+	if len(o.fourLWWhitelist) > 0 {
+		whitelist := strings.Join(o.fourLWWhitelist, ",")
+		env["ZOOKEEPER_4LW_COMMANDS_WHITELIST"] = whitelist
+		env["KAFKA_OPTS"] = "-Dzookeeper.4lw.commands.whitelist=" + whitelist
+	}
+	if len(o.jvmFlags) > 0 {
+		flags := strings.Join(o.jvmFlags, " ")
+		if existing, ok := env["KAFKA_OPTS"]; ok {
+			env["KAFKA_OPTS"] = existing + " " + flags
+		} else {
+			env["KAFKA_OPTS"] = flags
+		}
+	}
+	for k, v := range tlsEnv(o) {
+		if k == "KAFKA_OPTS" {
+			if existing, ok := env["KAFKA_OPTS"]; ok {
+				env["KAFKA_OPTS"] = existing + " " + v
+				continue
+			}
+		}
+		env[k] = v
+	}
+	for k, v := range o.extraEnv {
+		env[k] = v
+	}
+
+	image := o.image + ":" + o.version
+	files := tlsFiles(o)
+
 	for i := range c.requests {
+		perNode := make(map[string]string, len(env)+2)
+		for k, v := range env {
+			perNode[k] = v
+		}
+		perNode["ZOOKEEPER_SERVER_ID"] = id[i]
+		perNode["ZOOKEEPER_CLIENT_PORT"] = strconv.Itoa(c.options.clientPort)
+
 		c.requests[i] = testcontainers.GenericContainerRequest{
 			ContainerRequest: testcontainers.ContainerRequest{
-				Image:    "confluentinc/cp-zookeeper:7.3.2",
-				Hostname: hn[i],
-				Env: map[string]string{
-					"ZOOKEEPER_SERVER_ID":   id[i],
-					"ZOOKEEPER_CLIENT_PORT": strconv.Itoa(c.options.clientPort),
-					"ZOOKEEPER_SERVERS":     zks,
-				},
+				Image:        image,
+				Hostname:     hn[i],
+				Env:          perNode,
 				ExposedPorts: pp,
 				Networks:     o.networkNames,
 				WaitingFor:   wait.NewHostPortStrategy(nat.Port(pp[0])),
+				Files:        files,
 			},
 			Started: true,
 		}
+
+		if o.dataDir != "" {
+			nodeDir := filepath.Join(o.dataDir, hn[i])
+			c.requests[i].ContainerRequest.Mounts = testcontainers.ContainerMounts{
+				testcontainers.BindMount(filepath.Join(nodeDir, "data"), "/var/lib/zookeeper/data"),
+				testcontainers.BindMount(filepath.Join(nodeDir, "log"), "/var/lib/zookeeper/log"),
+			}
+		}
+
+		if o.tmpfs {
+			c.requests[i].ContainerRequest.HostConfigModifier = func(hc *container.HostConfig) {
+				hc.Tmpfs = map[string]string{
+					"/var/lib/zookeeper/data": "",
+					"/var/lib/zookeeper/log":  "",
+				}
+			}
+		}
 	}
 
+	c.hostnames = hn
+
 	return c
 }
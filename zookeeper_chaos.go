@@ -0,0 +1,168 @@
+package kharki
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/docker/go-connections/nat"
+)
+
+func (c *ZooKeeperCluster) containerByHostname(server string) (int, error) {
+	for i, hn := range c.hostnames {
+		if hn == server {
+			return i, nil
+		}
+	}
+
+	return -1, fmt.Errorf("no ZooKeeper server named %q in this cluster", server)
+}
+
+// Stop stops the named ensemble member's container and re-probes the
+// ensemble so callers can observe leader re-election.
+func (c *ZooKeeperCluster) Stop(ctx context.Context, server string) error {
+	i, err := c.containerByHostname(server)
+	if err != nil {
+		return err
+	}
+
+	if err := c.containers[i].Stop(ctx, nil); err != nil {
+		return fmt.Errorf("failed to stop ZooKeeper server %q: %w", server, err)
+	}
+
+	c.probe() //nolint:errcheck // best-effort re-probe, failure is expected with a member down
+
+	return nil
+}
+
+// StartServer starts the named ensemble member's container back up and
+// re-probes the ensemble so callers can observe it rejoining. It is named
+// StartServer, rather than Start, because Start is already taken by the
+// cluster-wide bootstrap method.
+func (c *ZooKeeperCluster) StartServer(ctx context.Context, server string) error {
+	i, err := c.containerByHostname(server)
+	if err != nil {
+		return err
+	}
+
+	if err := c.containers[i].Start(ctx); err != nil {
+		return fmt.Errorf("failed to start ZooKeeper server %q: %w", server, err)
+	}
+
+	// A restarted container may be given new host ports.
+	hp, err := c.containers[i].MappedPort(ctx, nat.Port(strconv.Itoa(c.options.clientPort)))
+	if err != nil {
+		return fmt.Errorf("failed to get port for ZooKeeper server %q: %w", server, err)
+	}
+	c.clientPorts[i] = hp.Port()
+
+	if c.options.tlsCA != nil {
+		hp, err := c.containers[i].MappedPort(ctx, nat.Port(strconv.Itoa(c.options.secureClientPort)))
+		if err != nil {
+			return fmt.Errorf("failed to get secure port for ZooKeeper server %q: %w", server, err)
+		}
+		c.secureClientPorts[i] = hp.Port()
+	}
+
+	c.probe() //nolint:errcheck // best-effort re-probe, failure is expected while it rejoins
+
+	return nil
+}
+
+// Pause freezes the named ensemble member's container without stopping it,
+// simulating a wedged process.
+func (c *ZooKeeperCluster) Pause(ctx context.Context, server string) error {
+	i, err := c.containerByHostname(server)
+	if err != nil {
+		return err
+	}
+
+	p, ok := c.containers[i].(interface{ Pause(context.Context) error })
+	if !ok {
+		return fmt.Errorf("failed to pause ZooKeeper server %q: container does not support pausing", server)
+	}
+
+	if err := p.Pause(ctx); err != nil {
+		return fmt.Errorf("failed to pause ZooKeeper server %q: %w", server, err)
+	}
+
+	c.probe() //nolint:errcheck // best-effort re-probe, failure is expected with a member frozen
+
+	return nil
+}
+
+// Unpause resumes a previously paused ensemble member and re-probes the
+// ensemble so callers can observe it rejoining.
+func (c *ZooKeeperCluster) Unpause(ctx context.Context, server string) error {
+	i, err := c.containerByHostname(server)
+	if err != nil {
+		return err
+	}
+
+	p, ok := c.containers[i].(interface{ Unpause(context.Context) error })
+	if !ok {
+		return fmt.Errorf("failed to unpause ZooKeeper server %q: container does not support unpausing", server)
+	}
+
+	if err := p.Unpause(ctx); err != nil {
+		return fmt.Errorf("failed to unpause ZooKeeper server %q: %w", server, err)
+	}
+
+	c.probe() //nolint:errcheck // best-effort re-probe while it rejoins
+
+	return nil
+}
+
+// PartitionFrom injects iptables DROP rules on server for every address in
+// peers, simulating a one-way network partition. The partition is one-way
+// until peers also drop server (PartitionFrom can be called with the roles
+// reversed to do that) and stays in place until HealPartition is called with
+// the same arguments, or the container is restarted.
+func (c *ZooKeeperCluster) PartitionFrom(ctx context.Context, server string, peers ...string) error {
+	if err := c.iptablesDrop(ctx, server, peers, "-A"); err != nil {
+		return err
+	}
+
+	c.probe() //nolint:errcheck // best-effort re-probe, failure is expected across a partition
+
+	return nil
+}
+
+// HealPartition removes the iptables DROP rules a prior PartitionFrom(ctx,
+// server, peers...) call injected on server, healing that side of the
+// partition so callers can observe the ensemble re-form.
+func (c *ZooKeeperCluster) HealPartition(ctx context.Context, server string, peers ...string) error {
+	if err := c.iptablesDrop(ctx, server, peers, "-D"); err != nil {
+		return err
+	}
+
+	c.probe() //nolint:errcheck // best-effort re-probe while the ensemble re-forms
+
+	return nil
+}
+
+func (c *ZooKeeperCluster) iptablesDrop(ctx context.Context, server string, peers []string, action string) error {
+	i, err := c.containerByHostname(server)
+	if err != nil {
+		return err
+	}
+
+	for _, peer := range peers {
+		j, err := c.containerByHostname(peer)
+		if err != nil {
+			return err
+		}
+
+		ip, err := c.containers[j].ContainerIP(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to resolve address of ZooKeeper server %q: %w", peer, err)
+		}
+
+		cmd := []string{"iptables", action, "INPUT", "-s", ip, "-j", "DROP"}
+		if err := execOrFail(ctx, c.containers[i], cmd); err != nil {
+			return fmt.Errorf("failed to update partition rule on ZooKeeper server %q for %q: %w", server, peer, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package kharki
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func snapshotArchivePath(hostname string) string {
+	return fmt.Sprintf("/tmp/%s-snapshot.tar.gz", hostname)
+}
+
+// execOrFail runs cmd in cont and turns a non-zero exit code into an error
+// carrying the command's combined output, since Exec itself only errors on
+// failure to start the command, not on the command's own exit status.
+func execOrFail(ctx context.Context, cont testcontainers.Container, cmd []string) error {
+	code, r, err := cont.Exec(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to run %q: %w", cmd, err)
+	}
+
+	if code != 0 {
+		out, _ := io.ReadAll(r)
+		return fmt.Errorf("failed to run %q: exit code %d: %s", cmd, code, out)
+	}
+
+	return nil
+}
+
+// Snapshot tars the data and log volumes out of every ensemble member's
+// container and writes one archive per hostname into dir, for later
+// restoring with Restore.
+func (c ZooKeeperCluster) Snapshot(ctx context.Context, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to snapshot ZooKeeper cluster: %w", err)
+	}
+
+	for i, cont := range c.containers {
+		hn := c.hostnames[i]
+		archive := snapshotArchivePath(hn)
+
+		cmd := []string{"tar", "czf", archive, "-C", "/", "var/lib/zookeeper/data", "var/lib/zookeeper/log"}
+		if err := execOrFail(ctx, cont, cmd); err != nil {
+			return fmt.Errorf("failed to snapshot ZooKeeper server %q: %w", hn, err)
+		}
+
+		rc, err := cont.CopyFileFromContainer(ctx, archive)
+		if err != nil {
+			return fmt.Errorf("failed to snapshot ZooKeeper server %q: %w", hn, err)
+		}
+
+		f, err := os.Create(filepath.Join(dir, hn+".tar.gz"))
+		if err != nil {
+			rc.Close()
+			return fmt.Errorf("failed to snapshot ZooKeeper server %q: %w", hn, err)
+		}
+
+		_, copyErr := f.ReadFrom(rc)
+		rc.Close()
+		f.Close()
+		if copyErr != nil {
+			return fmt.Errorf("failed to snapshot ZooKeeper server %q: %w", hn, copyErr)
+		}
+	}
+
+	return nil
+}
+
+// Restore untars the archives written by Snapshot back into each ensemble
+// member's data and log volumes. Callers are expected to call it against a
+// freshly started cluster, before the ensemble has formed quorum.
+func (c ZooKeeperCluster) Restore(ctx context.Context, dir string) error {
+	for i, cont := range c.containers {
+		hn := c.hostnames[i]
+
+		data, err := os.ReadFile(filepath.Join(dir, hn+".tar.gz"))
+		if err != nil {
+			return fmt.Errorf("failed to restore ZooKeeper server %q: %w", hn, err)
+		}
+
+		archive := snapshotArchivePath(hn)
+		if err := cont.CopyToContainer(ctx, data, archive, 0o644); err != nil {
+			return fmt.Errorf("failed to restore ZooKeeper server %q: %w", hn, err)
+		}
+
+		cmd := []string{"tar", "xzf", archive, "-C", "/"}
+		if err := execOrFail(ctx, cont, cmd); err != nil {
+			return fmt.Errorf("failed to restore ZooKeeper server %q: %w", hn, err)
+		}
+	}
+
+	return nil
+}
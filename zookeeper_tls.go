@@ -0,0 +1,192 @@
+package kharki
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func tlsFiles(o *zkOptions) []testcontainers.ContainerFile {
+	var files []testcontainers.ContainerFile
+
+	if o.tlsCA != nil {
+		files = append(files,
+			testcontainers.ContainerFile{Reader: bytes.NewReader(o.tlsCA), ContainerFilePath: "/etc/zookeeper/secrets/ca.pem", FileMode: 0o444},
+			testcontainers.ContainerFile{Reader: bytes.NewReader(o.tlsCert), ContainerFilePath: "/etc/zookeeper/secrets/cert.pem", FileMode: 0o444},
+			testcontainers.ContainerFile{Reader: bytes.NewReader(o.tlsKey), ContainerFilePath: "/etc/zookeeper/secrets/key.pem", FileMode: 0o400},
+		)
+	}
+
+	if o.saslUser != "" {
+		jaas := fmt.Sprintf(
+			"Server {\n  org.apache.zookeeper.server.auth.DigestLoginModule required\n  user_%s=\"%s\";\n};\n",
+			o.saslUser, o.saslPass,
+		)
+		files = append(files, testcontainers.ContainerFile{
+			Reader:            bytes.NewReader([]byte(jaas)),
+			ContainerFilePath: "/etc/zookeeper/secrets/jaas.conf",
+			FileMode:          0o444,
+		})
+	}
+
+	return files
+}
+
+func tlsEnv(o *zkOptions) map[string]string {
+	env := map[string]string{}
+
+	if o.tlsCA != nil {
+		env["ZOOKEEPER_SECURE_CLIENT_PORT"] = strconv.Itoa(o.secureClientPort)
+		env["ZOOKEEPER_SERVER_CNXN_FACTORY"] = "org.apache.zookeeper.server.NettyServerCnxnFactory"
+		env["ZOOKEEPER_SSL_TRUSTSTORE_LOCATION"] = "/etc/zookeeper/secrets/ca.pem"
+		env["ZOOKEEPER_SSL_TRUSTSTORE_TYPE"] = "PEM"
+		env["ZOOKEEPER_SSL_KEYSTORE_LOCATION"] = "/etc/zookeeper/secrets/cert.pem"
+		env["ZOOKEEPER_SSL_KEYSTORE_TYPE"] = "PEM"
+		env["ZOOKEEPER_SSL_KEY_LOCATION"] = "/etc/zookeeper/secrets/key.pem"
+		env["ZOOKEEPER_SSL_CLIENT_AUTH"] = "need"
+	}
+
+	if o.saslUser != "" {
+		env["ZOOKEEPER_REQUIRE_CLIENT_AUTH_SCHEME"] = "sasl"
+		env["ZOOKEEPER_AUTH_PROVIDER_SASL"] = "org.apache.zookeeper.server.auth.SASLAuthenticationProvider"
+
+		opt := "-Djava.security.auth.login.config=/etc/zookeeper/secrets/jaas.conf"
+		if existing, ok := env["KAFKA_OPTS"]; ok {
+			env["KAFKA_OPTS"] = existing + " " + opt
+		} else {
+			env["KAFKA_OPTS"] = opt
+		}
+	}
+
+	return env
+}
+
+// probeTLSFLW speaks the four-letter-word protocol directly over TLS, since
+// go-zookeeper's FLWSrvr dials plaintext only.
+func (c ZooKeeperCluster) probeTLSFLW() ([]*zk.ServerStats, error) {
+	cfg, err := c.tlsClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe ZooKeeper over TLS: %w", err)
+	}
+
+	ss := make([]*zk.ServerStats, len(c.secureClientPorts))
+	for i, p := range c.secureClientPorts {
+		addr := fmt.Sprintf("localhost:%s", p)
+
+		stat, err := flwSrvrTLS(addr, cfg)
+		if err != nil {
+			return ss, fmt.Errorf("failed to probe ZooKeeper over TLS, server %q raised an error: %w", addr, err)
+		}
+
+		ss[i] = stat
+	}
+
+	return ss, nil
+}
+
+// probeTLSConn falls back to establishing a plain ZooKeeper session over TLS
+// and reports liveness only, since the four-letter-word whitelist is empty
+// and leader/follower mode cannot be determined without it.
+func (c ZooKeeperCluster) probeTLSConn() ([]*zk.ServerStats, error) {
+	cfg, err := c.tlsClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe ZooKeeper over TLS: %w", err)
+	}
+
+	dialer := func(network, address string, timeout time.Duration) (net.Conn, error) {
+		return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, network, address, cfg)
+	}
+
+	ss := make([]*zk.ServerStats, len(c.secureClientPorts))
+	for i, p := range c.secureClientPorts {
+		addr := fmt.Sprintf("localhost:%s", p)
+
+		conn, events, err := zk.Connect([]string{addr}, time.Second*5, zk.WithDialer(dialer))
+		if err != nil {
+			return ss, fmt.Errorf("failed to probe ZooKeeper over TLS, server %q raised an error: %w", addr, err)
+		}
+
+		stat := &zk.ServerStats{Server: addr, Mode: zk.ModeUnknown}
+
+	waitForSession:
+		for {
+			select {
+			case e := <-events:
+				if e.State == zk.StateHasSession {
+					break waitForSession
+				}
+			case <-time.After(time.Second * 5):
+				conn.Close()
+				return ss, fmt.Errorf("failed to probe ZooKeeper over TLS, server %q raised an error: timed out waiting for session", addr)
+			}
+		}
+
+		conn.Close()
+		ss[i] = stat
+	}
+
+	return ss, nil
+}
+
+// tlsClientConfig builds the TLS config used to dial the secure client port.
+// ServerName is pinned to "localhost" because zk.Connect hands its dialer
+// resolved IP addresses rather than the "localhost:<port>" address, so the
+// server certificate must carry a "localhost" SAN (as WithZooKeeperTLS's
+// caller-provided certPEM is expected to) or verification will fail.
+func (c ZooKeeperCluster) tlsClientConfig() (*tls.Config, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(c.options.tlsCA) {
+		return nil, fmt.Errorf("failed to parse ZooKeeper TLS CA certificate")
+	}
+
+	cert, err := tls.X509KeyPair(c.options.tlsCert, c.options.tlsKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ZooKeeper TLS client certificate: %w", err)
+	}
+
+	return &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{cert},
+		ServerName:   "localhost",
+	}, nil
+}
+
+func flwSrvrTLS(addr string, cfg *tls.Config) (*zk.ServerStats, error) {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: time.Second * 2}, "tcp", addr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(time.Second * 2))
+
+	if _, err := conn.Write([]byte("srvr\n")); err != nil {
+		return nil, err
+	}
+
+	stat := &zk.ServerStats{Server: addr, Mode: zk.ModeStandalone}
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if after, ok := strings.CutPrefix(line, "Mode: "); ok {
+			switch strings.TrimSpace(after) {
+			case "leader":
+				stat.Mode = zk.ModeLeader
+			case "follower":
+				stat.Mode = zk.ModeFollower
+			}
+		}
+	}
+
+	return stat, nil
+}